@@ -0,0 +1,70 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/valyala/gozstd"
+)
+
+// Encode compresses data with enc, using cdict as the zstd dictionary when
+// enc is Zstd (cdict may be nil to compress without a dictionary).
+func Encode(enc Encoding, cdict *gozstd.CDict, data []byte) ([]byte, error) {
+	switch enc {
+	case Identity:
+		return data, nil
+	case Gzip:
+		pb := getGzipBuf()
+		defer putGzipBuf(pb)
+
+		gz := gzip.NewWriter(&pb.buf)
+		if _, err := gz.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip encode: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("gzip encode: %w", err)
+		}
+
+		out := make([]byte, pb.buf.Len())
+		copy(out, pb.buf.Bytes())
+
+		bytesIn.Add(float64(len(data)))
+		bytesOut.Add(float64(len(out)))
+		return out, nil
+	case Zstd:
+		return CompressDict(cdict, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", enc)
+	}
+}
+
+// Decode decompresses data that was encoded with enc, using ddict as the
+// zstd dictionary when enc is Zstd (ddict may be nil to decompress data
+// that wasn't compressed with a dictionary).
+func Decode(enc Encoding, ddict *gozstd.DDict, data []byte) ([]byte, error) {
+	switch enc {
+	case Identity:
+		return data, nil
+	case Gzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip decode: %w", err)
+		}
+		defer gz.Close()
+		out, err := io.ReadAll(gz)
+		if err != nil {
+			return nil, fmt.Errorf("gzip decode: %w", err)
+		}
+		return out, nil
+	case Zstd:
+		out, err := gozstd.DecompressDict(nil, data, ddict)
+		if err != nil {
+			return nil, fmt.Errorf("zstd decode: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", enc)
+	}
+}
@@ -0,0 +1,292 @@
+package compress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/valyala/gozstd"
+)
+
+// DefaultDictionaryKey is the blog used when a request's blog has no
+// dictionary of its own, or specifies none at all.
+const DefaultDictionaryKey = "default"
+
+// defaultDictLevel is the zstd level dictEntry.cdict is built at; it's
+// the level used whenever the adaptive compression policy (see
+// policy.go) doesn't ask for a different one.
+const defaultDictLevel = 9
+
+// DictInfo describes one loaded dictionary, as surfaced by the
+// /dictionaries admin endpoint.
+type DictInfo struct {
+	Blog   string `json:"blog"`
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	Digest string `json:"digest"`
+}
+
+type dictEntry struct {
+	data  []byte
+	cdict *gozstd.CDict
+	ddict *gozstd.DDict
+	info  DictInfo
+
+	// levels lazily caches CDicts built at levels other than
+	// defaultDictLevel, keyed by level (int) -> *gozstd.CDict.
+	levels sync.Map
+}
+
+// cdictAtLevel returns e's CDict built at level, building and caching it
+// on first use. Levels other than defaultDictLevel are comparatively rare
+// (only hit via X-Compression-Profile or the large-body tier), so they're
+// built lazily instead of up front for every dictionary.
+func (e *dictEntry) cdictAtLevel(level int) *gozstd.CDict {
+	if level == defaultDictLevel {
+		return e.cdict
+	}
+	if cd, ok := e.levels.Load(level); ok {
+		return cd.(*gozstd.CDict)
+	}
+
+	cd, err := gozstd.NewCDictLevel(e.data, level)
+	if err != nil {
+		// Fall back to the dictionary's default level rather than fail
+		// the request over a cosmetic compression-ratio choice.
+		return e.cdict
+	}
+
+	actual, _ := e.levels.LoadOrStore(level, cd)
+	return actual.(*gozstd.CDict)
+}
+
+// DictionaryManager holds one zstd dictionary pair per blog, loaded from a
+// directory of dictionary files (one file per blog, named
+// "<blog>.dict"), and keeps them up to date via an fsnotify watcher.
+// Readers go through an atomic.Pointer so lookups never block on a
+// reload.
+type DictionaryManager struct {
+	dir     string
+	entries atomic.Pointer[map[string]*dictEntry]
+	watcher *fsnotify.Watcher
+}
+
+// NewSingleDictionaryManager wraps a single dictionary file in a
+// DictionaryManager, as the DefaultDictionaryKey entry, for deployments
+// that don't need per-blog dictionaries. It does not watch the file for
+// changes.
+func NewSingleDictionaryManager(path string) (*DictionaryManager, error) {
+	dm := &DictionaryManager{dir: filepath.Dir(path)}
+
+	entry, err := loadDictEntry(DefaultDictionaryKey, path)
+	if err != nil {
+		return nil, err
+	}
+	dm.entries.Store(&map[string]*dictEntry{DefaultDictionaryKey: entry})
+
+	return dm, nil
+}
+
+// NewDictionaryManager loads every dictionary in dir and starts watching
+// it for changes.
+func NewDictionaryManager(dir string) (*DictionaryManager, error) {
+	dm := &DictionaryManager{dir: dir}
+
+	if err := dm.reloadAll(); err != nil {
+		return nil, err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start dictionary watcher: %w", err)
+	}
+	if err := w.Add(dir); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("failed to watch dictionary dir: %w", err)
+	}
+	dm.watcher = w
+
+	go dm.watch()
+
+	return dm, nil
+}
+
+func (dm *DictionaryManager) watch() {
+	for {
+		select {
+		case event, ok := <-dm.watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+
+			blog := blogKeyForPath(event.Name)
+			if err := dm.reloadOne(blog, event.Name); err != nil {
+				fmt.Printf("Failed to reload dictionary %q: %v\n", event.Name, err)
+				continue
+			}
+			dictionaryReloadsTotal.WithLabelValues(blog).Inc()
+		case err, ok := <-dm.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("Dictionary watcher error: %v\n", err)
+		}
+	}
+}
+
+func blogKeyForPath(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (dm *DictionaryManager) reloadAll() error {
+	files, err := os.ReadDir(dm.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read dictionary dir: %w", err)
+	}
+
+	entries := make(map[string]*dictEntry, len(files))
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".dict" {
+			continue
+		}
+		path := filepath.Join(dm.dir, f.Name())
+		entry, err := loadDictEntry(blogKeyForPath(path), path)
+		if err != nil {
+			return err
+		}
+		entries[entry.info.Blog] = entry
+	}
+
+	dm.entries.Store(&entries)
+	return nil
+}
+
+// reloadOne (re)loads the dictionary for a single blog after a file
+// watcher event, replacing the whole map with an updated copy so readers
+// via entries.Load never observe a partially-updated map. If the file no
+// longer exists, the blog's dictionary is removed.
+func (dm *DictionaryManager) reloadOne(blog, path string) error {
+	next := make(map[string]*dictEntry)
+	if current := dm.entries.Load(); current != nil {
+		for k, v := range *current {
+			next[k] = v
+		}
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		delete(next, blog)
+		dm.entries.Store(&next)
+		return nil
+	}
+
+	entry, err := loadDictEntry(blog, path)
+	if err != nil {
+		return err
+	}
+	next[blog] = entry
+
+	dm.entries.Store(&next)
+	return nil
+}
+
+func loadDictEntry(blog, path string) (*dictEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary %q: %w", path, err)
+	}
+
+	cd, err := gozstd.NewCDictLevel(data, defaultDictLevel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build CDict from %q: %w", path, err)
+	}
+	dd, err := gozstd.NewDDict(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DDict from %q: %w", path, err)
+	}
+
+	digest := sha256.Sum256(data)
+
+	return &dictEntry{
+		data:  data,
+		cdict: cd,
+		ddict: dd,
+		info: DictInfo{
+			Blog:   blog,
+			Path:   path,
+			Size:   len(data),
+			Digest: hex.EncodeToString(digest[:]),
+		},
+	}, nil
+}
+
+func (dm *DictionaryManager) get(blog string) *dictEntry {
+	entries := dm.entries.Load()
+	if entries == nil {
+		return nil
+	}
+	if e, ok := (*entries)[blog]; ok {
+		return e
+	}
+	return (*entries)[DefaultDictionaryKey]
+}
+
+// CDict returns the compression dictionary for blog, falling back to the
+// default dictionary when blog has none of its own.
+func (dm *DictionaryManager) CDict(blog string) *gozstd.CDict {
+	if e := dm.get(blog); e != nil {
+		return e.cdict
+	}
+	return nil
+}
+
+// DDict returns the decompression dictionary for blog, falling back to
+// the default dictionary when blog has none of its own.
+func (dm *DictionaryManager) DDict(blog string) *gozstd.DDict {
+	if e := dm.get(blog); e != nil {
+		return e.ddict
+	}
+	return nil
+}
+
+// CDictAtLevel returns blog's dictionary built at the given zstd level,
+// falling back to the default dictionary when blog has none of its own.
+// Levels other than defaultDictLevel are built and cached on first use.
+func (dm *DictionaryManager) CDictAtLevel(blog string, level int) *gozstd.CDict {
+	if e := dm.get(blog); e != nil {
+		return e.cdictAtLevel(level)
+	}
+	return nil
+}
+
+// List returns metadata for every currently loaded dictionary, for the
+// /dictionaries admin endpoint.
+func (dm *DictionaryManager) List() []DictInfo {
+	entries := dm.entries.Load()
+	if entries == nil {
+		return nil
+	}
+
+	list := make([]DictInfo, 0, len(*entries))
+	for _, e := range *entries {
+		list = append(list, e.info)
+	}
+	return list
+}
+
+// Close stops the dictionary file watcher.
+func (dm *DictionaryManager) Close() error {
+	if dm.watcher == nil {
+		return nil
+	}
+	return dm.watcher.Close()
+}
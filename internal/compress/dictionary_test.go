@@ -0,0 +1,145 @@
+package compress
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/valyala/gozstd"
+)
+
+// buildTestDict returns zstd dictionary bytes trained on enough repeated
+// content for ZDICT to succeed, suitable for writing to a ".dict" file in
+// tests.
+func buildTestDict(t *testing.T) []byte {
+	t.Helper()
+	var samples [][]byte
+	for i := 0; i < 50; i++ {
+		samples = append(samples, []byte(strings.Repeat("<p>hello world</p>", 20)))
+	}
+	dict := gozstd.BuildDict(samples, 4096)
+	if len(dict) == 0 {
+		t.Fatal("BuildDict returned an empty dictionary")
+	}
+	return dict
+}
+
+func TestNewSingleDictionaryManager(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "whatever.dict")
+	if err := os.WriteFile(path, buildTestDict(t), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	dm, err := NewSingleDictionaryManager(path)
+	if err != nil {
+		t.Fatalf("NewSingleDictionaryManager: %v", err)
+	}
+	defer dm.Close()
+
+	if dm.CDict(DefaultDictionaryKey) == nil {
+		t.Error("CDict(DefaultDictionaryKey) = nil, want a dictionary")
+	}
+	if dm.DDict(DefaultDictionaryKey) == nil {
+		t.Error("DDict(DefaultDictionaryKey) = nil, want a dictionary")
+	}
+
+	// A blog with no dictionary of its own falls back to the default.
+	if dm.CDict("some-other-blog") != dm.CDict(DefaultDictionaryKey) {
+		t.Error("CDict for an unknown blog did not fall back to the default dictionary")
+	}
+}
+
+func TestDictionaryManagerPerBlogFallback(t *testing.T) {
+	dir := t.TempDir()
+	dict := buildTestDict(t)
+	if err := os.WriteFile(filepath.Join(dir, "default.dict"), dict, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blog-a.dict"), dict, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	dm, err := NewDictionaryManager(dir)
+	if err != nil {
+		t.Fatalf("NewDictionaryManager: %v", err)
+	}
+	defer dm.Close()
+
+	if dm.CDict("blog-a") == nil {
+		t.Error("CDict(\"blog-a\") = nil, want a dictionary")
+	}
+	if dm.CDict("blog-with-no-dict") == nil {
+		t.Error("CDict for an unknown blog = nil, want the default dictionary")
+	}
+
+	list := dm.List()
+	if len(list) != 2 {
+		t.Fatalf("List() returned %d entries, want 2", len(list))
+	}
+}
+
+func TestDictionaryManagerReloadOne(t *testing.T) {
+	dir := t.TempDir()
+	dict := buildTestDict(t)
+	if err := os.WriteFile(filepath.Join(dir, "default.dict"), dict, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	dm, err := NewDictionaryManager(dir)
+	if err != nil {
+		t.Fatalf("NewDictionaryManager: %v", err)
+	}
+	defer dm.Close()
+
+	if dm.CDict("blog-a") != dm.CDict(DefaultDictionaryKey) {
+		t.Fatal("expected blog-a to fall back to the default dictionary before it has one")
+	}
+
+	blogAPath := filepath.Join(dir, "blog-a.dict")
+	if err := os.WriteFile(blogAPath, dict, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := dm.reloadOne("blog-a", blogAPath); err != nil {
+		t.Fatalf("reloadOne: %v", err)
+	}
+	if dm.CDict("blog-a") == nil {
+		t.Error("CDict(\"blog-a\") = nil after reloadOne added its dictionary")
+	}
+
+	if err := os.Remove(blogAPath); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := dm.reloadOne("blog-a", blogAPath); err != nil {
+		t.Fatalf("reloadOne after removal: %v", err)
+	}
+	if dm.CDict("blog-a") != dm.CDict(DefaultDictionaryKey) {
+		t.Error("blog-a should fall back to the default dictionary again once its file is removed")
+	}
+}
+
+func TestDictionaryManagerCDictAtLevelCachesPerLevel(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "default.dict"), buildTestDict(t), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	dm, err := NewDictionaryManager(dir)
+	if err != nil {
+		t.Fatalf("NewDictionaryManager: %v", err)
+	}
+	defer dm.Close()
+
+	if dm.CDictAtLevel(DefaultDictionaryKey, defaultDictLevel) != dm.CDict(DefaultDictionaryKey) {
+		t.Error("CDictAtLevel at the default level should return the same CDict as CDict")
+	}
+
+	fast := dm.CDictAtLevel(DefaultDictionaryKey, 3)
+	if fast == nil {
+		t.Fatal("CDictAtLevel(3) = nil, want a dictionary")
+	}
+	if dm.CDictAtLevel(DefaultDictionaryKey, 3) != fast {
+		t.Error("CDictAtLevel(3) built a new CDict instead of returning the cached one")
+	}
+}
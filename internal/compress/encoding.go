@@ -0,0 +1,145 @@
+// Package compress implements HTTP content-coding negotiation and encoding
+// for the precompressor's zstd/gzip/identity pipeline.
+package compress
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Encoding identifies a supported HTTP content-coding.
+type Encoding int
+
+const (
+	// Identity means the payload is passed through unmodified.
+	Identity Encoding = iota
+	// Gzip compresses the payload with gzip.
+	Gzip
+	// Zstd compresses the payload with zstd, optionally using a dictionary.
+	Zstd
+)
+
+// String returns the value used in the Content-Encoding / Accept-Encoding
+// headers for e.
+func (e Encoding) String() string {
+	switch e {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	default:
+		return "identity"
+	}
+}
+
+// Supported lists the encodings this server can produce, in preference
+// order: when the client accepts several at the same q-value, the earlier
+// one wins.
+var Supported = []Encoding{Zstd, Gzip, Identity}
+
+// ParseEncoding maps a Content-Encoding token to an Encoding. ok is false
+// for tokens we don't support.
+func ParseEncoding(token string) (enc Encoding, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(token)) {
+	case "", "identity":
+		return Identity, true
+	case "gzip":
+		return Gzip, true
+	case "zstd":
+		return Zstd, true
+	default:
+		return Identity, false
+	}
+}
+
+// Negotiate picks the best encoding among Supported for the given
+// Accept-Encoding header value, honoring q-values, "*", and
+// "identity;q=0". ok is false when none of the encodings we support are
+// acceptable to the client, in which case callers should respond 406.
+func Negotiate(acceptEncoding string) (enc Encoding, ok bool) {
+	if strings.TrimSpace(acceptEncoding) == "" {
+		return Identity, true
+	}
+
+	qValues := make(map[Encoding]float64, len(Supported))
+	wildcardQ := -1.0
+	identityListed := false
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, q := parseCodingAndQ(part)
+		if name == "" {
+			continue
+		}
+
+		if name == "*" {
+			wildcardQ = q
+			continue
+		}
+
+		if e, known := ParseEncoding(name); known {
+			qValues[e] = q
+			if e == Identity {
+				identityListed = true
+			}
+		}
+	}
+
+	// Per RFC 9110 §12.5.3, identity is acceptable unless explicitly
+	// excluded (q=0) or excluded via a matching "*;q=0" with no explicit
+	// identity entry.
+	if !identityListed {
+		if wildcardQ >= 0 {
+			qValues[Identity] = wildcardQ
+		} else {
+			qValues[Identity] = 1e-9
+		}
+	}
+
+	best := Identity
+	bestQ := 0.0
+	for _, e := range Supported {
+		q, explicit := qValues[e]
+		if !explicit {
+			if wildcardQ < 0 {
+				continue
+			}
+			q = wildcardQ
+		}
+		if q > bestQ {
+			bestQ = q
+			best = e
+		}
+	}
+
+	if bestQ <= 0 {
+		return Identity, false
+	}
+	return best, true
+}
+
+// parseCodingAndQ splits a single Accept-Encoding list element such as
+// " gzip;q=0.8 " into its coding name and q-value (default 1).
+func parseCodingAndQ(part string) (name string, q float64) {
+	part = strings.TrimSpace(part)
+	if part == "" {
+		return "", 0
+	}
+
+	q = 1
+	name = part
+	if idx := strings.IndexByte(part, ';'); idx >= 0 {
+		name = strings.TrimSpace(part[:idx])
+		for _, param := range strings.Split(part[idx+1:], ";") {
+			param = strings.TrimSpace(param)
+			val, found := strings.CutPrefix(param, "q=")
+			if !found {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+
+	return strings.ToLower(name), q
+}
@@ -0,0 +1,56 @@
+package compress
+
+import "testing"
+
+func TestParseEncoding(t *testing.T) {
+	cases := []struct {
+		token   string
+		wantEnc Encoding
+		wantOK  bool
+	}{
+		{"", Identity, true},
+		{"identity", Identity, true},
+		{"gzip", Gzip, true},
+		{"GZIP", Gzip, true},
+		{" zstd ", Zstd, true},
+		{"br", Identity, false},
+		{"bogus", Identity, false},
+	}
+
+	for _, tc := range cases {
+		enc, ok := ParseEncoding(tc.token)
+		if enc != tc.wantEnc || ok != tc.wantOK {
+			t.Errorf("ParseEncoding(%q) = (%v, %v), want (%v, %v)", tc.token, enc, ok, tc.wantEnc, tc.wantOK)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		name           string
+		acceptEncoding string
+		wantEnc        Encoding
+		wantOK         bool
+	}{
+		{"empty header means identity", "", Identity, true},
+		{"no q-values picks most preferred supported", "gzip, zstd", Zstd, true},
+		{"explicit q-values break ties", "zstd;q=0.5, gzip;q=0.8", Gzip, true},
+		{"wildcard fills in unlisted codings", "*", Zstd, true},
+		{"wildcard q=0 excludes everything not explicitly listed", "*;q=0", Identity, false},
+		{"explicit identity;q=0 excludes identity but not others", "identity;q=0, gzip;q=0.5", Gzip, true},
+		{"identity;q=0 alone with nothing else acceptable", "identity;q=0", Identity, false},
+		{"wildcard q=0 with an explicit exception", "*;q=0, gzip;q=1", Gzip, true},
+		{"unsupported codings are ignored", "br;q=1, zstd;q=0.1", Zstd, true},
+		{"only unsupported codings falls back to identity", "br;q=1", Identity, true},
+		{"whitespace around tokens is tolerated", " zstd ; q=0.9 , gzip ", Gzip, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, ok := Negotiate(tc.acceptEncoding)
+			if enc != tc.wantEnc || ok != tc.wantOK {
+				t.Errorf("Negotiate(%q) = (%v, %v), want (%v, %v)", tc.acceptEncoding, enc, ok, tc.wantEnc, tc.wantOK)
+			}
+		})
+	}
+}
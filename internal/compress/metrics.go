@@ -0,0 +1,55 @@
+package compress
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	poolHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "html_storage_pool_hits_total",
+		Help: "Number of times a pooled buffer was reused instead of allocated.",
+	}, []string{"pool"})
+
+	poolMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "html_storage_pool_misses_total",
+		Help: "Number of times a pooled buffer had to be allocated because the pool was empty.",
+	}, []string{"pool"})
+
+	bytesIn = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "html_storage_compress_bytes_in_total",
+		Help: "Total uncompressed bytes fed into the compressor.",
+	})
+
+	bytesOut = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "html_storage_compress_bytes_out_total",
+		Help: "Total compressed bytes produced by the compressor.",
+	})
+
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "html_storage_worker_pool_queue_depth",
+		Help: "Number of compression jobs currently queued but not yet picked up by a worker.",
+	})
+
+	inFlightWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "html_storage_worker_pool_inflight_workers",
+		Help: "Number of worker pool goroutines currently executing a compression job.",
+	})
+
+	dictionaryReloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "html_storage_dictionary_reloads_total",
+		Help: "Number of times a per-blog zstd dictionary was (re)loaded from disk.",
+	}, []string{"blog"})
+
+	compressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "html_storage_compression_ratio",
+		Help:    "Ratio of compressed to uncompressed bytes chosen by the adaptive compression policy, labeled by the zstd level used (\"0\" for identity).",
+		Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+	}, []string{"level"})
+
+	compressionLevel = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "html_storage_compression_level",
+		Help:    "Zstd compression level chosen by the adaptive compression policy (0 for identity), so operators can A/B-tune the size thresholds.",
+		Buckets: []float64{0, 3, 9, 15, 19},
+	})
+)
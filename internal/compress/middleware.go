@@ -0,0 +1,128 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blogContextKey is where handlers stash the blog a request is for, so
+// Middleware can pick the right dictionary when encoding the response
+// after the handler has parsed the request body.
+const blogContextKey = "compress.blog"
+
+// SetBlog records the blog a request belongs to, so the response can be
+// compressed with that blog's dictionary. Call it from a handler once the
+// blog is known (e.g. after parsing the request body).
+func SetBlog(c *gin.Context, blog string) {
+	c.Set(blogContextKey, blog)
+}
+
+// responseRecorder buffers everything written by the handler so Middleware
+// can compress it as a whole before it hits the wire.
+type responseRecorder struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	return r.buf.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	return r.buf.WriteString(s)
+}
+
+// streamingContentType is the request Content-Type that marks a raw,
+// unbuffered upload (see main.go's streamUpstream branch on POST /:id). Its
+// whole point is to avoid holding a multi-MB body in memory, so Middleware
+// must not run its Content-Encoding buffering step against it.
+const streamingContentType = "application/octet-stream"
+
+// Middleware returns a gin middleware that transparently decompresses
+// request bodies that arrive with a Content-Encoding header. The zstd
+// dictionary for inbound decoding is picked via dm using the "blog" query
+// parameter (the only blog hint available before the body has been
+// parsed), falling back to dm's default dictionary.
+//
+// Requests with a streaming Content-Type are exempt: decoding them would
+// require buffering the whole body, defeating the point of streaming, so a
+// Content-Encoding other than identity is rejected outright instead.
+func Middleware(dm *DictionaryManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqEnc := c.GetHeader("Content-Encoding")
+		if reqEnc == "" {
+			c.Next()
+			return
+		}
+
+		enc, ok := ParseEncoding(reqEnc)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported Content-Encoding"})
+			return
+		}
+		if enc == Identity {
+			c.Next()
+			return
+		}
+
+		if c.ContentType() == streamingContentType {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Encoding is not supported for streaming uploads"})
+			return
+		}
+
+		raw, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		decoded, err := Decode(enc, dm.DDict(c.Query("blog")), raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to decode request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(decoded))
+		c.Request.ContentLength = int64(len(decoded))
+		c.Request.Header.Del("Content-Encoding")
+
+		c.Next()
+	}
+}
+
+// NegotiateResponse returns a gin middleware that negotiates a response
+// encoding from the request's Accept-Encoding header and compresses
+// whatever the handler writes accordingly, aborting with 406 if nothing
+// acceptable to the client is supported. It's only meaningful for routes
+// that actually serve bytes back to the client (e.g. GET /:id); ack-only
+// endpoints that just report success/failure shouldn't have their storage
+// gated on an unrelated response-encoding header, so they don't use this
+// middleware and simply respond as identity. The zstd dictionary for
+// outbound encoding is picked via dm using whatever blog the handler
+// recorded with SetBlog, if any, falling back to dm's default dictionary.
+func NegotiateResponse(dm *DictionaryManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		respEnc, ok := Negotiate(c.GetHeader("Accept-Encoding"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"error": "no acceptable encoding"})
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		c.Next()
+
+		blog, _ := c.Value(blogContextKey).(string)
+		encoded, err := Encode(respEnc, dm.CDict(blog), rec.buf.Bytes())
+		if err != nil {
+			rec.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if respEnc != Identity {
+			rec.ResponseWriter.Header().Set("Content-Encoding", respEnc.String())
+		}
+		rec.ResponseWriter.Header().Del("Content-Length")
+		_, _ = rec.ResponseWriter.Write(encoded)
+	}
+}
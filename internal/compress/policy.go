@@ -0,0 +1,108 @@
+package compress
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Profile is a request-level override for the adaptive compression
+// policy, set via the X-Compression-Profile header.
+type Profile string
+
+const (
+	// ProfileDefault picks encoding and level from the body size, per
+	// sizeTiers.
+	ProfileDefault Profile = "default"
+	// ProfileFast always compresses cheaply, for latency-sensitive
+	// callers that would rather not pay for a better ratio.
+	ProfileFast Profile = "fast"
+	// ProfileMax always compresses for the best ratio, for callers doing
+	// a one-off bulk re-encode where latency doesn't matter.
+	ProfileMax Profile = "max"
+)
+
+// ParseProfile maps an X-Compression-Profile header value to a Profile,
+// defaulting to ProfileDefault for an empty or unrecognized value.
+func ParseProfile(header string) Profile {
+	switch strings.ToLower(strings.TrimSpace(header)) {
+	case "fast":
+		return ProfileFast
+	case "max":
+		return ProfileMax
+	default:
+		return ProfileDefault
+	}
+}
+
+// compressionTier is one row of the adaptive compression policy: bodies
+// it applies to are compressed with encoding/level, using the blog's
+// dictionary when useDict is set.
+type compressionTier struct {
+	maxBytes int64 // exclusive upper bound; -1 means unbounded
+	encoding Encoding
+	level    int
+	useDict  bool
+}
+
+// sizeTiers is ProfileDefault's policy table: small bodies aren't worth
+// spending CPU on, and the ratio win from a higher level and a dictionary
+// grows with body size, so both ramp up together. Tune these by watching
+// html_storage_compression_ratio and html_storage_compression_level.
+var sizeTiers = []compressionTier{
+	{maxBytes: 1024, encoding: Identity},
+	{maxBytes: 32 * 1024, encoding: Zstd, level: 3, useDict: true},
+	{maxBytes: 1024 * 1024, encoding: Zstd, level: 9, useDict: true},
+	{maxBytes: -1, encoding: Zstd, level: 15, useDict: false},
+}
+
+var (
+	fastTier = compressionTier{encoding: Zstd, level: 3, useDict: true}
+	maxTier  = compressionTier{encoding: Zstd, level: 19, useDict: false}
+)
+
+// chooseTier picks the compression tier for a body of the given size and
+// profile.
+func chooseTier(size int, profile Profile) compressionTier {
+	switch profile {
+	case ProfileFast:
+		return fastTier
+	case ProfileMax:
+		return maxTier
+	default:
+		for _, t := range sizeTiers {
+			if t.maxBytes < 0 || int64(size) <= t.maxBytes {
+				return t
+			}
+		}
+		return sizeTiers[len(sizeTiers)-1]
+	}
+}
+
+// CompressAdaptive compresses data, picking the encoding and (for Zstd)
+// the level and dictionary use from len(data) and profile, per
+// chooseTier. dm supplies the per-blog dictionary when the chosen tier
+// calls for one. It returns the encoded bytes and the Encoding used, and
+// records the chosen level and resulting ratio so operators can tune
+// sizeTiers.
+func CompressAdaptive(dm *DictionaryManager, blog string, profile Profile, data []byte) ([]byte, Encoding) {
+	tier := chooseTier(len(data), profile)
+
+	var out []byte
+	switch tier.encoding {
+	case Zstd:
+		if tier.useDict {
+			out = CompressDict(dm.CDictAtLevel(blog, tier.level), data)
+		} else {
+			out = CompressLevel(tier.level, data)
+		}
+	default:
+		out = data
+	}
+
+	compressionLevel.Observe(float64(tier.level))
+	if len(data) > 0 {
+		compressionRatio.WithLabelValues(strconv.Itoa(tier.level)).Observe(float64(len(out)) / float64(len(data)))
+	}
+
+	return out, tier.encoding
+}
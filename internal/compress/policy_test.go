@@ -0,0 +1,66 @@
+package compress
+
+import "testing"
+
+func TestChooseTierSizeBoundaries(t *testing.T) {
+	cases := []struct {
+		name     string
+		size     int
+		wantEnc  Encoding
+		wantLvl  int
+		wantDict bool
+	}{
+		{"just under the identity ceiling", 1023, Identity, 0, false},
+		{"exactly at the identity ceiling", 1024, Identity, 0, false},
+		{"just over the identity ceiling", 1025, Zstd, 3, true},
+		{"just under the mid tier ceiling", 32 * 1024, Zstd, 3, true},
+		{"just over the mid tier ceiling", 32*1024 + 1, Zstd, 9, true},
+		{"just under the large tier ceiling", 1024 * 1024, Zstd, 9, true},
+		{"just over the large tier ceiling", 1024*1024 + 1, Zstd, 15, false},
+		{"far beyond any bound", 100 * 1024 * 1024, Zstd, 15, false},
+		{"empty body", 0, Identity, 0, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tier := chooseTier(tc.size, ProfileDefault)
+			if tier.encoding != tc.wantEnc || tier.level != tc.wantLvl || tier.useDict != tc.wantDict {
+				t.Errorf("chooseTier(%d, ProfileDefault) = {%v %d %v}, want {%v %d %v}",
+					tc.size, tier.encoding, tier.level, tier.useDict, tc.wantEnc, tc.wantLvl, tc.wantDict)
+			}
+		})
+	}
+}
+
+func TestChooseTierProfileOverridesSize(t *testing.T) {
+	sizes := []int{0, 1, 1024, 32 * 1024, 1024 * 1024, 100 * 1024 * 1024}
+
+	for _, size := range sizes {
+		if tier := chooseTier(size, ProfileFast); tier != fastTier {
+			t.Errorf("chooseTier(%d, ProfileFast) = %+v, want fastTier %+v", size, tier, fastTier)
+		}
+		if tier := chooseTier(size, ProfileMax); tier != maxTier {
+			t.Errorf("chooseTier(%d, ProfileMax) = %+v, want maxTier %+v", size, tier, maxTier)
+		}
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	cases := []struct {
+		header string
+		want   Profile
+	}{
+		{"", ProfileDefault},
+		{"default", ProfileDefault},
+		{"fast", ProfileFast},
+		{"FAST", ProfileFast},
+		{" max ", ProfileMax},
+		{"bogus", ProfileDefault},
+	}
+
+	for _, tc := range cases {
+		if got := ParseProfile(tc.header); got != tc.want {
+			t.Errorf("ParseProfile(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package compress
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/valyala/gozstd"
+)
+
+// pooledBuf tracks whether it was just allocated by the pool's New func so
+// Get can attribute the retrieval to a pool hit or miss.
+type pooledBuf struct {
+	buf   []byte
+	fresh bool
+}
+
+const defaultBufCap = 4096
+
+type pooledBuffer struct {
+	buf   bytes.Buffer
+	fresh bool
+}
+
+var gzipBufPool = sync.Pool{
+	New: func() interface{} {
+		poolMisses.WithLabelValues("gzip_buf").Inc()
+		return &pooledBuffer{fresh: true}
+	},
+}
+
+func getGzipBuf() *pooledBuffer {
+	pb := gzipBufPool.Get().(*pooledBuffer)
+	if pb.fresh {
+		pb.fresh = false
+	} else {
+		poolHits.WithLabelValues("gzip_buf").Inc()
+	}
+	pb.buf.Reset()
+	return pb
+}
+
+func putGzipBuf(pb *pooledBuffer) {
+	gzipBufPool.Put(pb)
+}
+
+var zstdDstPool = sync.Pool{
+	New: func() interface{} {
+		poolMisses.WithLabelValues("zstd_dst").Inc()
+		return &pooledBuf{buf: make([]byte, 0, defaultBufCap), fresh: true}
+	},
+}
+
+func getZstdDst() *pooledBuf {
+	pb := zstdDstPool.Get().(*pooledBuf)
+	if pb.fresh {
+		pb.fresh = false
+	} else {
+		poolHits.WithLabelValues("zstd_dst").Inc()
+	}
+	return pb
+}
+
+func putZstdDst(pb *pooledBuf) {
+	zstdDstPool.Put(pb)
+}
+
+// CompressDict compresses src with cdict, reusing a pooled destination
+// slice across calls instead of allocating one per request. The returned
+// slice is owned by the caller; the pooled backing array is recycled for
+// the next compression.
+func CompressDict(cdict *gozstd.CDict, src []byte) []byte {
+	pb := getZstdDst()
+	compressed := gozstd.CompressDict(pb.buf[:0], src, cdict)
+
+	out := make([]byte, len(compressed))
+	copy(out, compressed)
+
+	pb.buf = compressed
+	putZstdDst(pb)
+
+	bytesIn.Add(float64(len(src)))
+	bytesOut.Add(float64(len(out)))
+
+	return out
+}
+
+// CompressLevel compresses src at compressionLevel without a dictionary,
+// reusing a pooled destination slice the same way CompressDict does.
+func CompressLevel(compressionLevel int, src []byte) []byte {
+	pb := getZstdDst()
+	compressed := gozstd.CompressLevel(pb.buf[:0], src, compressionLevel)
+
+	out := make([]byte, len(compressed))
+	copy(out, compressed)
+
+	pb.buf = compressed
+	putZstdDst(pb)
+
+	bytesIn.Add(float64(len(src)))
+	bytesOut.Add(float64(len(out)))
+
+	return out
+}
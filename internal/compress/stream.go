@@ -0,0 +1,74 @@
+package compress
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/valyala/gozstd"
+)
+
+// countingWriter tallies bytes written through it so callers can measure
+// compressed output size without buffering it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// StreamCompress copies r through a streaming zstd encoder into w,
+// using cdict as the dictionary (nil for none). Unlike CompressDict, it
+// never holds the uncompressed body in memory, so it's suited to large
+// HTML bodies that shouldn't be buffered in full before compressing.
+func StreamCompress(w io.Writer, r io.Reader, cdict *gozstd.CDict) (bytesOut int64, err error) {
+	cw := &countingWriter{w: w}
+
+	zw := gozstd.NewWriterDict(cw, cdict)
+	defer zw.Release()
+
+	if _, err := io.Copy(zw, r); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	return cw.n, nil
+}
+
+// WriteFrame writes a single length-prefixed batch entry to w: the id,
+// blog and timestamp metadata followed by the already zstd-compressed
+// payload. Frames are written back to back with no outer envelope, so the
+// reader on the other end knows it has read a full batch only once the
+// underlying stream (itself framed at the HTTP layer via chunked transfer
+// encoding) reaches EOF.
+func WriteFrame(w io.Writer, id, blog string, timestamp int64, payload []byte) error {
+	if err := writeLengthPrefixed(w, []byte(id)); err != nil {
+		return err
+	}
+	if err := writeLengthPrefixed(w, []byte(blog)); err != nil {
+		return err
+	}
+
+	var tsBuf [8]byte
+	binary.BigEndian.PutUint64(tsBuf[:], uint64(timestamp))
+	if _, err := w.Write(tsBuf[:]); err != nil {
+		return err
+	}
+
+	return writeLengthPrefixed(w, payload)
+}
+
+func writeLengthPrefixed(w io.Writer, data []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
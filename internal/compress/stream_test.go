@@ -0,0 +1,145 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/valyala/gozstd"
+)
+
+// readFrame reads back a single WriteFrame-encoded entry, mirroring the
+// wire format documented on WriteFrame.
+func readFrame(r io.Reader) (id, blog string, timestamp int64, payload []byte, err error) {
+	idBytes, err := readLengthPrefixed(r)
+	if err != nil {
+		return "", "", 0, nil, err
+	}
+	blogBytes, err := readLengthPrefixed(r)
+	if err != nil {
+		return "", "", 0, nil, err
+	}
+
+	var tsBuf [8]byte
+	if _, err := io.ReadFull(r, tsBuf[:]); err != nil {
+		return "", "", 0, nil, err
+	}
+
+	payload, err = readLengthPrefixed(r)
+	if err != nil {
+		return "", "", 0, nil, err
+	}
+
+	return string(idBytes), string(blogBytes), int64(binary.BigEndian.Uint64(tsBuf[:])), payload, nil
+}
+
+func readLengthPrefixed(r io.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func TestWriteFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	wantPayload := []byte{0xde, 0xad, 0xbe, 0xef, 0x00}
+
+	if err := WriteFrame(&buf, "post-1", "myblog", 1700000000, wantPayload); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+
+	id, blog, timestamp, payload, err := readFrame(&buf)
+	if err != nil {
+		t.Fatalf("readFrame: %v", err)
+	}
+	if id != "post-1" || blog != "myblog" || timestamp != 1700000000 || !bytes.Equal(payload, wantPayload) {
+		t.Errorf("readFrame = (%q, %q, %d, %x), want (%q, %q, %d, %x)",
+			id, blog, timestamp, payload, "post-1", "myblog", 1700000000, wantPayload)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d trailing bytes left after reading one frame, want 0", buf.Len())
+	}
+}
+
+func TestWriteFrameMultipleBackToBack(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteFrame(&buf, "a", "blog-a", 1, []byte("one")); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if err := WriteFrame(&buf, "b", "blog-b", 2, []byte("two")); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+
+	id, blog, timestamp, payload, err := readFrame(&buf)
+	if err != nil || id != "a" || blog != "blog-a" || timestamp != 1 || string(payload) != "one" {
+		t.Fatalf("first frame = (%q, %q, %d, %q, %v), want (a, blog-a, 1, one, nil)", id, blog, timestamp, payload, err)
+	}
+
+	id, blog, timestamp, payload, err = readFrame(&buf)
+	if err != nil || id != "b" || blog != "blog-b" || timestamp != 2 || string(payload) != "two" {
+		t.Fatalf("second frame = (%q, %q, %d, %q, %v), want (b, blog-b, 2, two, nil)", id, blog, timestamp, payload, err)
+	}
+}
+
+func TestStreamCompressRoundTrip(t *testing.T) {
+	input := strings.Repeat("<p>hello world</p>", 100)
+
+	var out bytes.Buffer
+	n, err := StreamCompress(&out, strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatalf("StreamCompress: %v", err)
+	}
+	if n != int64(out.Len()) {
+		t.Errorf("StreamCompress reported %d bytes, buffer holds %d", n, out.Len())
+	}
+
+	decompressed, err := gozstd.Decompress(nil, out.Bytes())
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	if string(decompressed) != input {
+		t.Errorf("round-tripped content mismatch: got %d bytes, want %d bytes", len(decompressed), len(input))
+	}
+}
+
+func TestStreamCompressWithDictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 50; i++ {
+		samples = append(samples, []byte(strings.Repeat("<p>hello world</p>", 20)))
+	}
+	dict := gozstd.BuildDict(samples, 4096)
+
+	cdict, err := gozstd.NewCDictLevel(dict, 3)
+	if err != nil {
+		t.Fatalf("NewCDictLevel: %v", err)
+	}
+	defer cdict.Release()
+	ddict, err := gozstd.NewDDict(dict)
+	if err != nil {
+		t.Fatalf("NewDDict: %v", err)
+	}
+	defer ddict.Release()
+
+	input := strings.Repeat("<p>hello world</p>", 100)
+
+	var out bytes.Buffer
+	if _, err := StreamCompress(&out, strings.NewReader(input), cdict); err != nil {
+		t.Fatalf("StreamCompress: %v", err)
+	}
+
+	decompressed, err := gozstd.DecompressDict(nil, out.Bytes(), ddict)
+	if err != nil {
+		t.Fatalf("DecompressDict: %v", err)
+	}
+	if string(decompressed) != input {
+		t.Errorf("round-tripped content mismatch: got %d bytes, want %d bytes", len(decompressed), len(input))
+	}
+}
@@ -0,0 +1,57 @@
+package compress
+
+// WorkerPool bounds the number of goroutines concurrently running
+// compression jobs, so a burst of requests can't exhaust memory or
+// sockets the way an unbounded "go func() {...}()" per request can.
+type WorkerPool struct {
+	jobs chan func()
+}
+
+// NewWorkerPool starts a pool of workers goroutines draining a queue of
+// capacity queueSize. Once the queue is full, Submit and SubmitWait
+// return false immediately instead of blocking, so callers can surface
+// backpressure to the client.
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	p := &WorkerPool{
+		jobs: make(chan func(), queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go p.runWorker()
+	}
+	return p
+}
+
+func (p *WorkerPool) runWorker() {
+	for job := range p.jobs {
+		queueDepth.Dec()
+		inFlightWorkers.Inc()
+		job()
+		inFlightWorkers.Dec()
+	}
+}
+
+// Submit enqueues job to run asynchronously on a worker. It returns false
+// without running job if the queue is already full.
+func (p *WorkerPool) Submit(job func()) bool {
+	select {
+	case p.jobs <- job:
+		queueDepth.Inc()
+		return true
+	default:
+		return false
+	}
+}
+
+// SubmitWait enqueues job and blocks until a worker has finished running
+// it. It returns false without running job if the queue is already full.
+func (p *WorkerPool) SubmitWait(job func()) bool {
+	done := make(chan struct{})
+	if !p.Submit(func() {
+		job()
+		close(done)
+	}) {
+		return false
+	}
+	<-done
+	return true
+}
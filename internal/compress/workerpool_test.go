@@ -0,0 +1,112 @@
+package compress
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolSubmitRunsJob(t *testing.T) {
+	pool := NewWorkerPool(1, 1)
+
+	done := make(chan struct{})
+	if !pool.Submit(func() { close(done) }) {
+		t.Fatal("Submit returned false with capacity available")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job was never run")
+	}
+}
+
+func TestWorkerPoolSubmitReturnsFalseWhenQueueFull(t *testing.T) {
+	// No workers draining the queue, so the one slot of capacity fills up
+	// and stays full.
+	pool := &WorkerPool{jobs: make(chan func(), 1)}
+
+	if !pool.Submit(func() {}) {
+		t.Fatal("Submit returned false while the queue still had room")
+	}
+	if pool.Submit(func() {}) {
+		t.Fatal("Submit returned true with a full queue, want false")
+	}
+}
+
+func TestWorkerPoolSubmitWaitBlocksUntilJobFinishes(t *testing.T) {
+	pool := NewWorkerPool(1, 1)
+
+	var ran bool
+	var mu sync.Mutex
+
+	if !pool.SubmitWait(func() {
+		mu.Lock()
+		ran = true
+		mu.Unlock()
+	}) {
+		t.Fatal("SubmitWait returned false with capacity available")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !ran {
+		t.Fatal("SubmitWait returned before the job ran")
+	}
+}
+
+func TestWorkerPoolSubmitWaitReturnsFalseWhenQueueFull(t *testing.T) {
+	pool := &WorkerPool{jobs: make(chan func(), 1)}
+
+	if !pool.Submit(func() {}) {
+		t.Fatal("Submit returned false while the queue still had room")
+	}
+	if pool.SubmitWait(func() { t.Fatal("job should never run on a full queue") }) {
+		t.Fatal("SubmitWait returned true with a full queue, want false")
+	}
+}
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	const workers = 3
+	pool := NewWorkerPool(workers, workers*2)
+
+	var (
+		mu      sync.Mutex
+		current int
+		peak    int
+	)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers*2; i++ {
+		wg.Add(1)
+		if !pool.Submit(func() {
+			defer wg.Done()
+			mu.Lock()
+			current++
+			if current > peak {
+				peak = current
+			}
+			mu.Unlock()
+
+			<-release
+
+			mu.Lock()
+			current--
+			mu.Unlock()
+		}) {
+			wg.Done()
+			t.Fatal("Submit returned false with capacity available")
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak > workers {
+		t.Errorf("peak concurrency = %d, want at most %d", peak, workers)
+	}
+}
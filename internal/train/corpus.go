@@ -0,0 +1,102 @@
+// Package train builds and validates zstd dictionaries for the
+// precompressor from a corpus of sample HTML bodies, closing the loop
+// between serving (internal/compress) and training in one binary.
+package train
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Sample is one corpus entry used to train or validate a dictionary.
+type Sample struct {
+	Name string
+	Data []byte
+}
+
+// scriptBlock and styleBlock match <script>...</script> and
+// <style>...</style> elements, including their content. They're matched
+// separately (rather than as a single alternation) so that literal
+// "</style>" text inside a <script> body, or vice versa, can't make the
+// non-greedy match end at the wrong element's closing tag.
+var (
+	scriptBlock = regexp.MustCompile(`(?is)<script\b[^>]*>.*?</script>`)
+	styleBlock  = regexp.MustCompile(`(?is)<style\b[^>]*>.*?</style>`)
+)
+
+// stripNoise removes script/style blocks from html. Dictionaries trained
+// directly on page source end up dominated by whatever third-party JS or
+// CSS happens to be inlined in the sample set, at the expense of the
+// actual prose and markup structure that's common across a blog's pages.
+func stripNoise(html []byte) []byte {
+	html = scriptBlock.ReplaceAll(html, nil)
+	html = styleBlock.ReplaceAll(html, nil)
+	return html
+}
+
+// CollectFromDir loads every file matching glob as a sample, stripping
+// script/style noise from each.
+func CollectFromDir(glob string) ([]Sample, error) {
+	paths, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, fmt.Errorf("invalid samples glob %q: %w", glob, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files matched samples glob %q", glob)
+	}
+
+	samples := make([]Sample, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sample %q: %w", path, err)
+		}
+		samples = append(samples, Sample{Name: path, Data: stripNoise(data)})
+	}
+	return samples, nil
+}
+
+// CollectFromURLs fetches each URL and strips script/style noise from
+// the response body to form a sample.
+func CollectFromURLs(client *http.Client, urls []string) ([]Sample, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no sample URLs given")
+	}
+
+	samples := make([]Sample, 0, len(urls))
+	for _, url := range urls {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch sample %q: %w", url, err)
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sample %q: %w", url, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching sample %q returned status %d", url, resp.StatusCode)
+		}
+
+		samples = append(samples, Sample{Name: url, Data: stripNoise(data)})
+	}
+	return samples, nil
+}
+
+// SplitHeldOut splits samples into a training set and a held-out set for
+// validation, taking every fifth sample (by index) as held out.
+func SplitHeldOut(samples []Sample) (train, heldOut []Sample) {
+	for i, s := range samples {
+		if i%5 == 0 {
+			heldOut = append(heldOut, s)
+		} else {
+			train = append(train, s)
+		}
+	}
+	return train, heldOut
+}
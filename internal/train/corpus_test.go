@@ -0,0 +1,123 @@
+package train
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripNoise(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			"strips a script block",
+			`<p>keep</p><script>var x = "</style> not a tag";</script><p>me</p>`,
+			`<p>keep</p><p>me</p>`,
+		},
+		{
+			"strips a style block",
+			`<p>keep</p><style>.a { content: "</script>"; }</style><p>me</p>`,
+			`<p>keep</p><p>me</p>`,
+		},
+		{
+			"strips attributes on the opening tag",
+			`<script type="text/javascript">alert(1)</script><p>me</p>`,
+			`<p>me</p>`,
+		},
+		{
+			"leaves markup with no script or style alone",
+			`<p>hello <b>world</b></p>`,
+			`<p>hello <b>world</b></p>`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(stripNoise([]byte(tc.in))); got != tc.want {
+				t.Errorf("stripNoise(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCollectFromDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.html"), []byte(`<p>a</p><script>bad</script>`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.html"), []byte(`<p>b</p>`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	samples, err := CollectFromDir(filepath.Join(dir, "*.html"))
+	if err != nil {
+		t.Fatalf("CollectFromDir: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	for _, s := range samples {
+		if s.Name == filepath.Join(dir, "a.html") && string(s.Data) != "<p>a</p>" {
+			t.Errorf("a.html sample = %q, want noise stripped", s.Data)
+		}
+	}
+}
+
+func TestCollectFromDirNoMatches(t *testing.T) {
+	if _, err := CollectFromDir(filepath.Join(t.TempDir(), "*.html")); err == nil {
+		t.Fatal("CollectFromDir with no matches returned nil error, want one")
+	}
+}
+
+func TestCollectFromURLs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<p>fetched</p><style>.x{}</style>`))
+	}))
+	defer srv.Close()
+
+	samples, err := CollectFromURLs(srv.Client(), []string{srv.URL})
+	if err != nil {
+		t.Fatalf("CollectFromURLs: %v", err)
+	}
+	if len(samples) != 1 || string(samples[0].Data) != "<p>fetched</p>" {
+		t.Errorf("samples = %+v, want one sample with noise stripped", samples)
+	}
+}
+
+func TestCollectFromURLsNoURLs(t *testing.T) {
+	if _, err := CollectFromURLs(http.DefaultClient, nil); err == nil {
+		t.Fatal("CollectFromURLs with no URLs returned nil error, want one")
+	}
+}
+
+func TestCollectFromURLsNonOKStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if _, err := CollectFromURLs(srv.Client(), []string{srv.URL}); err == nil {
+		t.Fatal("CollectFromURLs with a 404 response returned nil error, want one")
+	}
+}
+
+func TestSplitHeldOut(t *testing.T) {
+	samples := make([]Sample, 10)
+	for i := range samples {
+		samples[i] = Sample{Name: string(rune('a' + i))}
+	}
+
+	train, heldOut := SplitHeldOut(samples)
+
+	if len(heldOut) != 2 || heldOut[0].Name != "a" || heldOut[1].Name != "f" {
+		t.Errorf("heldOut = %+v, want every fifth sample starting at index 0", heldOut)
+	}
+	if len(train) != 8 {
+		t.Errorf("len(train) = %d, want 8", len(train))
+	}
+}
@@ -0,0 +1,94 @@
+package train
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/valyala/gozstd"
+)
+
+// BuildDict trains a new zstd dictionary of approximately dictSize bytes
+// from samples.
+func BuildDict(samples []Sample, dictSize int) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples to train on")
+	}
+
+	raw := make([][]byte, len(samples))
+	for i, s := range samples {
+		raw[i] = s.Data
+	}
+	return gozstd.BuildDict(raw, dictSize), nil
+}
+
+// WriteDict writes dict to path.
+func WriteDict(path string, dict []byte) error {
+	if err := os.WriteFile(path, dict, 0o644); err != nil {
+		return fmt.Errorf("failed to write dictionary to %q: %w", path, err)
+	}
+	return nil
+}
+
+// Comparison is one side (old or new) of a ValidationResult.
+type Comparison struct {
+	Ratio      float64
+	AvgLatency time.Duration
+}
+
+// ValidationResult reports how a newly trained dictionary compares to
+// the one it would replace, over the same held-out sample set.
+type ValidationResult struct {
+	Old Comparison
+	New Comparison
+}
+
+// Validate compresses every sample in heldOut with both oldDict and
+// newDict at level 9 (the level compress.DictionaryManager builds its
+// default CDict at) and reports the mean compression ratio and latency
+// for each, so operators can decide whether to roll the new dictionary
+// forward.
+func Validate(oldDict, newDict []byte, heldOut []Sample) (ValidationResult, error) {
+	if len(heldOut) == 0 {
+		return ValidationResult{}, fmt.Errorf("no held-out samples to validate against")
+	}
+
+	oldCDict, err := gozstd.NewCDictLevel(oldDict, 9)
+	if err != nil {
+		return ValidationResult{}, fmt.Errorf("failed to build CDict from old dictionary: %w", err)
+	}
+	newCDict, err := gozstd.NewCDictLevel(newDict, 9)
+	if err != nil {
+		return ValidationResult{}, fmt.Errorf("failed to build CDict from new dictionary: %w", err)
+	}
+
+	result := ValidationResult{}
+	for _, s := range heldOut {
+		oldRatio, oldLatency := compressOne(oldCDict, s.Data)
+		newRatio, newLatency := compressOne(newCDict, s.Data)
+
+		result.Old.Ratio += oldRatio
+		result.Old.AvgLatency += oldLatency
+		result.New.Ratio += newRatio
+		result.New.AvgLatency += newLatency
+	}
+
+	n := time.Duration(len(heldOut))
+	result.Old.Ratio /= float64(len(heldOut))
+	result.Old.AvgLatency /= n
+	result.New.Ratio /= float64(len(heldOut))
+	result.New.AvgLatency /= n
+
+	return result, nil
+}
+
+func compressOne(cdict *gozstd.CDict, data []byte) (ratio float64, latency time.Duration) {
+	start := time.Now()
+	compressed := gozstd.CompressDict(nil, data, cdict)
+	latency = time.Since(start)
+
+	if len(data) == 0 {
+		return 0, latency
+	}
+	return float64(len(compressed)) / float64(len(data)), latency
+}
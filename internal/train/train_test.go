@@ -0,0 +1,64 @@
+package train
+
+import (
+	"strings"
+	"testing"
+)
+
+func repeatedSamples(n int) []Sample {
+	samples := make([]Sample, n)
+	for i := range samples {
+		samples[i] = Sample{
+			Name: "sample",
+			Data: []byte(strings.Repeat("<p>hello world</p>", 20)),
+		}
+	}
+	return samples
+}
+
+func TestBuildDictNoSamples(t *testing.T) {
+	if _, err := BuildDict(nil, 4096); err == nil {
+		t.Fatal("BuildDict with no samples returned nil error, want one")
+	}
+}
+
+func TestBuildDictProducesDictionary(t *testing.T) {
+	dict, err := BuildDict(repeatedSamples(50), 4096)
+	if err != nil {
+		t.Fatalf("BuildDict: %v", err)
+	}
+	if len(dict) == 0 {
+		t.Fatal("BuildDict returned an empty dictionary")
+	}
+}
+
+func TestValidateNoHeldOutSamples(t *testing.T) {
+	dict, err := BuildDict(repeatedSamples(50), 4096)
+	if err != nil {
+		t.Fatalf("BuildDict: %v", err)
+	}
+	if _, err := Validate(dict, dict, nil); err == nil {
+		t.Fatal("Validate with no held-out samples returned nil error, want one")
+	}
+}
+
+func TestValidateReportsCompressionRatio(t *testing.T) {
+	samples := repeatedSamples(50)
+	train, heldOut := SplitHeldOut(samples)
+
+	dict, err := BuildDict(train, 4096)
+	if err != nil {
+		t.Fatalf("BuildDict: %v", err)
+	}
+
+	result, err := Validate(dict, dict, heldOut)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if result.Old.Ratio <= 0 || result.New.Ratio <= 0 {
+		t.Errorf("Validate result = %+v, want positive compression ratios", result)
+	}
+	if result.Old.Ratio != result.New.Ratio {
+		t.Errorf("validating the same dictionary against itself gave different ratios: %+v", result)
+	}
+}
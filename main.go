@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/akamensky/argparse"
@@ -15,7 +17,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/valyala/gozstd"
+
+	"github.com/geulgyeol/html-precompressor/internal/compress"
+	"github.com/geulgyeol/html-precompressor/internal/train"
 )
 
 var (
@@ -26,9 +30,21 @@ var (
 	})
 )
 
-var cdict *gozstd.CDict
+var dictMgr *compress.DictionaryManager
+
+// precompressRequest is the payload shape accepted by both the single and
+// batch ingest endpoints.
+type precompressRequest struct {
+	Body      string `json:"body"`
+	Blog      string `json:"blog"`
+	Timestamp int64  `json:"timestamp"`
+}
 
-func compressHTML(html string) []byte {
+// compressHTML compresses html for storage using the adaptive policy in
+// compress.CompressAdaptive (see policy.go), and returns the compressed
+// bytes along with the encoding that was chosen so the caller can record
+// it alongside the stored body for later decompression.
+func compressHTML(html, blog string, profile compress.Profile) ([]byte, compress.Encoding) {
 	//var buf bytes.Buffer
 	//gz := gzip.NewWriter(&buf)
 	//_, _ = gz.Write([]byte(html))
@@ -39,9 +55,182 @@ func compressHTML(html string) []byte {
 		fileCompressionDuration.Observe(time.Since(start).Seconds())
 	}()
 
-	compressedData := gozstd.CompressDict(nil, []byte(html), cdict)
+	return compress.CompressAdaptive(dictMgr, blog, profile, []byte(html))
+}
+
+// handleStreamedBatch serves POST /batch when --stream-upstream is set: it
+// decodes the request body one entry at a time instead of buffering the
+// whole map, and forwards each compressed entry to the upstream as a
+// length-prefixed frame over a chunked, un-base64'd request body.
+func handleStreamedBatch(c *gin.Context, pool *compress.WorkerPool, client *http.Client, originalEndpoint string, dictMgr *compress.DictionaryManager) {
+	pr, pw := io.Pipe()
+
+	upstreamErr := make(chan error, 1)
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/batch?is_precompressed=true&framed=true", originalEndpoint), pr)
+		if err != nil {
+			upstreamErr <- err
+			return
+		}
+		// This body is WriteFrame's custom id/blog/timestamp + zstd-blob
+		// framing, not a single valid zstd stream, so it must not be
+		// labeled plain "zstd" — an upstream that honors Content-Encoding
+		// literally would try to zstd-decompress the whole thing and fail.
+		req.Header.Set("Content-Encoding", "zstd-framed")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			upstreamErr <- err
+			return
+		}
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+
+		if resp.StatusCode != http.StatusOK {
+			upstreamErr <- fmt.Errorf("original endpoint returned non-OK status: %d", resp.StatusCode)
+			return
+		}
+		upstreamErr <- nil
+	}()
+
+	dec := json.NewDecoder(c.Request.Body)
+	if _, err := dec.Token(); err != nil {
+		_ = pw.CloseWithError(err)
+		<-upstreamErr
+		c.JSON(400, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	var (
+		queueFull bool
+		stored    int
+		total     int
+	)
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			<-upstreamErr
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		id, _ := keyTok.(string)
+
+		var item precompressRequest
+		if err := dec.Decode(&item); err != nil {
+			_ = pw.CloseWithError(err)
+			<-upstreamErr
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		total++
 
-	return compressedData
+		if queueFull {
+			// Already out of capacity: keep draining the request body so
+			// total is accurate, but stop submitting work and stop
+			// writing any more frames to the upstream.
+			continue
+		}
+
+		if !pool.SubmitWait(func() {
+			compressed := compress.CompressDict(dictMgr.CDict(item.Blog), []byte(item.Body))
+			_ = compress.WriteFrame(pw, id, item.Blog, item.Timestamp, compressed)
+		}) {
+			queueFull = true
+			continue
+		}
+		stored++
+	}
+
+	// Close the pipe cleanly (not with an error) even when the queue
+	// filled mid-batch, so the upstream POST completes with whatever
+	// frames were already written instead of seeing a truncated body and
+	// discarding them.
+	_ = pw.Close()
+	if err := <-upstreamErr; err != nil {
+		fmt.Printf("Error sending streamed batch to original endpoint: %v\n", err)
+		c.JSON(500, gin.H{"error": "Failed to send to original endpoint"})
+		return
+	}
+
+	if queueFull {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "compression queue is full; some items were not stored",
+			"stored": stored,
+			"total":  total,
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "success"})
+}
+
+// trainConfig holds the parsed flags for the "train" subcommand.
+type trainConfig struct {
+	samplesGlob   string
+	sampleURLs    []string
+	dictSize      int
+	output        string
+	validate      bool
+	oldDictionary string
+}
+
+// runTrain implements the "train" subcommand: it builds a corpus from
+// either a local glob or a list of URLs, trains a new dictionary with
+// gozstd.BuildDict, optionally validates it against the dictionary it
+// would replace, and writes it to cfg.output.
+func runTrain(cfg trainConfig) {
+	var (
+		samples []train.Sample
+		err     error
+	)
+	switch {
+	case len(cfg.sampleURLs) > 0:
+		samples, err = train.CollectFromURLs(&http.Client{Timeout: 30 * time.Second}, cfg.sampleURLs)
+	case cfg.samplesGlob != "":
+		samples, err = train.CollectFromDir(cfg.samplesGlob)
+	default:
+		panic("train: one of --samples-glob or --sample-urls is required")
+	}
+	if err != nil {
+		panic(fmt.Sprintf("train: failed to collect samples: %v", err))
+	}
+
+	trainSet := samples
+	var heldOut []train.Sample
+	if cfg.validate {
+		trainSet, heldOut = train.SplitHeldOut(samples)
+	}
+
+	fmt.Printf("Training dictionary from %d samples (target size %d bytes)...\n", len(trainSet), cfg.dictSize)
+	dict, err := train.BuildDict(trainSet, cfg.dictSize)
+	if err != nil {
+		panic(fmt.Sprintf("train: %v (corpus too small for --validate's 80/20 split?)", err))
+	}
+
+	if cfg.validate {
+		oldDict, err := os.ReadFile(cfg.oldDictionary)
+		if err != nil {
+			panic(fmt.Sprintf("train: failed to read --old-dictionary %q: %v", cfg.oldDictionary, err))
+		}
+
+		result, err := train.Validate(oldDict, dict, heldOut)
+		if err != nil {
+			panic(fmt.Sprintf("train: validation failed: %v", err))
+		}
+
+		fmt.Printf("Validation over %d held-out samples:\n", len(heldOut))
+		fmt.Printf("  old dictionary: ratio=%.4f avg_latency=%s\n", result.Old.Ratio, result.Old.AvgLatency)
+		fmt.Printf("  new dictionary: ratio=%.4f avg_latency=%s\n", result.New.Ratio, result.New.AvgLatency)
+		fmt.Printf("  delta:          ratio=%+.4f avg_latency=%s\n", result.New.Ratio-result.Old.Ratio, result.New.AvgLatency-result.Old.AvgLatency)
+	}
+
+	if err := train.WriteDict(cfg.output, dict); err != nil {
+		panic(fmt.Sprintf("train: %v", err))
+	}
+	fmt.Printf("Wrote trained dictionary (%d bytes) to %s\n", len(dict), cfg.output)
 }
 
 func main() {
@@ -52,27 +241,56 @@ func main() {
 	port := parser.Int("p", "port", &argparse.Options{Default: 8080, Help: "Port to run the server on"})
 	originalEndpoint := parser.String("o", "original-endpoint", &argparse.Options{Default: "http://html-storage.default.svc.cluster.local", Help: "Original HTML storage server endpoint"})
 	zstdDictionaryPath := parser.String("z", "zstd-dictionary", &argparse.Options{Default: "./zstd_dict", Help: "Path to Zstd dictionary file"})
+	zstdDictionaryDir := parser.String("", "zstd-dictionary-dir", &argparse.Options{Default: "", Help: "Directory of per-blog Zstd dictionaries, named <blog>.dict (overrides --zstd-dictionary, hot-reloaded on change)"})
+	workers := parser.Int("", "workers", &argparse.Options{Default: 16, Help: "Number of concurrent compression workers"})
+	queueSize := parser.Int("", "queue-size", &argparse.Options{Default: 256, Help: "Maximum number of compression jobs queued before returning 503"})
+	streamUpstream := parser.Flag("", "stream-upstream", &argparse.Options{Help: "Skip base64 and stream zstd-compressed bodies to the original endpoint with chunked transfer encoding"})
+
+	trainCmd := parser.NewCommand("train", "Train a new Zstd dictionary from a corpus of sample HTML bodies")
+	trainSamplesGlob := trainCmd.String("", "samples-glob", &argparse.Options{Default: "", Help: "Glob pattern for local HTML sample files to train on (mutually exclusive with --sample-urls)"})
+	trainSampleURLs := trainCmd.StringList("", "sample-urls", &argparse.Options{Help: "URLs to fetch HTML samples from, instead of --samples-glob"})
+	trainDictSize := trainCmd.Int("", "dict-size", &argparse.Options{Default: 112640, Help: "Target size in bytes of the trained dictionary"})
+	trainOutput := trainCmd.String("", "output", &argparse.Options{Default: "./zstd_dict", Help: "Path to write the trained dictionary to"})
+	trainValidate := trainCmd.Flag("", "validate", &argparse.Options{Help: "Hold out a fifth of the corpus and compare its compression ratio/latency against --old-dictionary before writing the new one"})
+	trainOldDictionary := trainCmd.String("", "old-dictionary", &argparse.Options{Default: "./zstd_dict", Help: "Existing dictionary to compare against in --validate mode"})
 
 	err := parser.Parse(os.Args)
 	if err != nil {
 		panic(err)
 	}
 
-	// Load Zstd dictionary
-	dictData, err := os.ReadFile(*zstdDictionaryPath)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to read Zstd dictionary: %v", err))
+	if trainCmd.Happened() {
+		runTrain(trainConfig{
+			samplesGlob:   *trainSamplesGlob,
+			sampleURLs:    *trainSampleURLs,
+			dictSize:      *trainDictSize,
+			output:        *trainOutput,
+			validate:      *trainValidate,
+			oldDictionary: *trainOldDictionary,
+		})
+		return
 	}
 
-	cdict, err = gozstd.NewCDictLevel(dictData, 9)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create Zstd dictionary: %v", err))
+	// Load Zstd dictionaries: either a single dictionary shared by every
+	// blog, or a hot-reloaded directory of per-blog dictionaries.
+	if *zstdDictionaryDir != "" {
+		dictMgr, err = compress.NewDictionaryManager(*zstdDictionaryDir)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to load Zstd dictionary dir: %v", err))
+		}
+	} else {
+		dictMgr, err = compress.NewSingleDictionaryManager(*zstdDictionaryPath)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to load Zstd dictionary: %v", err))
+		}
 	}
 
 	client := &http.Client{
 		Timeout: 120 * time.Second,
 	}
 
+	pool := compress.NewWorkerPool(*workers, *queueSize)
+
 	r := gin.Default()
 
 	// Prometheus metrics endpoint
@@ -82,73 +300,174 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	r.POST("/:id", func(c *gin.Context) {
-		var body struct {
-			Body      string `json:"body"`
-			Blog      string `json:"blog"`
-			Timestamp int64  `json:"timestamp"`
+	content := r.Group("")
+	content.Use(compress.Middleware(dictMgr))
+
+	r.GET("/dictionaries", func(c *gin.Context) {
+		c.JSON(200, gin.H{"dictionaries": dictMgr.List()})
+	})
+
+	content.POST("/:id", func(c *gin.Context) {
+		id := c.Param("id")
+
+		// Streaming mode: the request body is the raw HTML itself (no
+		// JSON envelope, no base64), so it never has to be buffered in
+		// full before compressing. Only available once the upstream has
+		// been told it understands the framed, chunked format.
+		if *streamUpstream && c.ContentType() == "application/octet-stream" {
+			blog := c.Query("blog")
+			timestamp, _ := strconv.ParseInt(c.Query("timestamp"), 10, 64)
+
+			// The actual zstd compression is the CPU-bound part and is
+			// what the worker pool bounds; sending the compressed stream
+			// to the original endpoint is just I/O wait, so it runs in
+			// its own unbounded-but-cheap goroutine instead of occupying
+			// a worker slot for the round trip's duration.
+			pr, pw := io.Pipe()
+			submitted := pool.Submit(func() {
+				_, err := compress.StreamCompress(pw, c.Request.Body, dictMgr.CDict(blog))
+				_ = pw.CloseWithError(err)
+			})
+			if !submitted {
+				_ = pr.Close()
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "compression queue is full"})
+				return
+			}
+
+			go func() {
+				req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s?is_precompressed=true&blog=%s&timestamp=%d", *originalEndpoint, id, blog, timestamp), pr)
+				if err != nil {
+					fmt.Printf("Error building streamed request: %v\n", err)
+					return
+				}
+				req.Header.Set("Content-Encoding", "zstd")
+
+				resp, err := client.Do(req)
+				if err != nil {
+					fmt.Printf("Error sending to original endpoint: %v\n", err)
+					return
+				}
+				defer func(Body io.ReadCloser) {
+					_ = Body.Close()
+				}(resp.Body)
+
+				if resp.StatusCode != http.StatusOK {
+					fmt.Printf("Original endpoint returned non-OK status: %d\n", resp.StatusCode)
+				}
+			}()
+
+			c.JSON(200, gin.H{"status": "success"})
+			return
 		}
 
+		var body precompressRequest
+
 		if err := c.BindJSON(&body); err != nil {
 			c.JSON(400, gin.H{"error": "Invalid JSON"})
 			return
 		}
-
-		go func() {
-			compressedHTML := compressHTML(body.Body)
-
-			// send to original endpoint
-			reqBody := map[string]interface{}{
-				"body":      base64.StdEncoding.EncodeToString(compressedHTML),
-				"blog":      body.Blog,
-				"timestamp": body.Timestamp,
-			}
-			jsonData, _ := json.Marshal(reqBody)
-
-			resp, err := client.Post(fmt.Sprintf("%s/%s?is_precompressed=true", *originalEndpoint, c.Param("id")), "application/json", bytes.NewBuffer(jsonData))
-			if err != nil {
-				fmt.Printf("Error sending to original endpoint: %v\n", err)
-				return
-			}
-			defer func(Body io.ReadCloser) {
-				_ = Body.Close()
-			}(resp.Body)
-
-			if resp.StatusCode != http.StatusOK {
-				fmt.Printf("Original endpoint returned non-OK status: %d\n", resp.StatusCode)
-			}
-		}()
+		compress.SetBlog(c, body.Blog)
+		profile := compress.ParseProfile(c.GetHeader("X-Compression-Profile"))
+
+		// Only the compression itself is CPU-bound, so only it runs on
+		// the pooled worker; the upstream send is I/O wait and runs in
+		// its own unbounded-but-cheap goroutine once compression is
+		// done, so a slow original-endpoint response can't tie up a
+		// worker slot.
+		submitted := pool.Submit(func() {
+			compressedHTML, enc := compressHTML(body.Body, body.Blog, profile)
+
+			go func() {
+				reqBody := map[string]interface{}{
+					"body":      base64.StdEncoding.EncodeToString(compressedHTML),
+					"blog":      body.Blog,
+					"timestamp": body.Timestamp,
+					"encoding":  enc.String(),
+				}
+				jsonData, _ := json.Marshal(reqBody)
+
+				resp, err := client.Post(fmt.Sprintf("%s/%s?is_precompressed=true", *originalEndpoint, id), "application/json", bytes.NewBuffer(jsonData))
+				if err != nil {
+					fmt.Printf("Error sending to original endpoint: %v\n", err)
+					return
+				}
+				defer func(Body io.ReadCloser) {
+					_ = Body.Close()
+				}(resp.Body)
+
+				if resp.StatusCode != http.StatusOK {
+					fmt.Printf("Original endpoint returned non-OK status: %d\n", resp.StatusCode)
+				}
+			}()
+		})
+		if !submitted {
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "compression queue is full"})
+			return
+		}
 
 		c.JSON(200, gin.H{"status": "success"})
 	})
 
-	r.POST("/batch", func(c *gin.Context) {
-		var body map[string]struct {
-			Body      string `json:"body"`
-			Blog      string `json:"blog"`
-			Timestamp int64  `json:"timestamp"`
+	content.POST("/batch", func(c *gin.Context) {
+		if *streamUpstream {
+			handleStreamedBatch(c, pool, client, *originalEndpoint, dictMgr)
+			return
 		}
 
+		var body map[string]precompressRequest
+
 		if err := c.BindJSON(&body); err != nil {
 			c.JSON(400, gin.H{"error": "Invalid JSON"})
 			return
 		}
+		profile := compress.ParseProfile(c.GetHeader("X-Compression-Profile"))
 
-		// compress all
+		// compress all, bounded by the shared worker pool
 
-		var compressedBodies = make(map[string]map[string]interface{})
+		var (
+			mu               sync.Mutex
+			wg               sync.WaitGroup
+			compressedBodies = make(map[string]map[string]interface{}, len(body))
+			queueFull        bool
+		)
 
 		for id, item := range body {
-			compressedHTML := compressHTML(item.Body)
+			wg.Add(1)
+			go func(id string, item precompressRequest) {
+				defer wg.Done()
+
+				ok := pool.SubmitWait(func() {
+					compressedHTML, enc := compressHTML(item.Body, item.Blog, profile)
+
+					mu.Lock()
+					compressedBodies[id] = map[string]interface{}{
+						"body":      base64.StdEncoding.EncodeToString(compressedHTML),
+						"blog":      item.Blog,
+						"timestamp": item.Timestamp,
+						"encoding":  enc.String(),
+					}
+					mu.Unlock()
+				})
+				if !ok {
+					mu.Lock()
+					queueFull = true
+					mu.Unlock()
+				}
+			}(id, item)
+		}
+		wg.Wait()
 
-			compressedBodies[id] = map[string]interface{}{
-				"body":      base64.StdEncoding.EncodeToString(compressedHTML),
-				"blog":      item.Blog,
-				"timestamp": item.Timestamp,
-			}
+		if queueFull && len(compressedBodies) == 0 {
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "compression queue is full"})
+			return
 		}
 
-		// send to original endpoint
+		// Send whatever compressed successfully to the original endpoint
+		// rather than discarding completed work just because some items
+		// didn't get a worker slot in time.
 
 		jsonData, _ := json.Marshal(compressedBodies)
 
@@ -168,9 +487,76 @@ func main() {
 			return
 		}
 
+		if queueFull {
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":  "compression queue is full; some items were not stored",
+				"stored": len(compressedBodies),
+				"total":  len(body),
+			})
+			return
+		}
+
 		c.JSON(200, gin.H{"status": "success"})
 	})
 
+	content.GET("/:id", compress.NegotiateResponse(dictMgr), func(c *gin.Context) {
+		resp, err := client.Get(fmt.Sprintf("%s/%s", *originalEndpoint, c.Param("id")))
+		if err != nil {
+			fmt.Printf("Error fetching from original endpoint: %v\n", err)
+			c.JSON(500, gin.H{"error": "Failed to fetch from original endpoint"})
+			return
+		}
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Original endpoint returned non-OK status: %d\n", resp.StatusCode)
+			c.JSON(resp.StatusCode, gin.H{"error": "Original endpoint returned non-OK status"})
+			return
+		}
+
+		var stored struct {
+			Body     string `json:"body"`
+			Blog     string `json:"blog"`
+			Encoding string `json:"encoding"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&stored); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to decode original endpoint response"})
+			return
+		}
+
+		compressedHTML, err := base64.StdEncoding.DecodeString(stored.Body)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to decode stored body"})
+			return
+		}
+
+		// Entries stored before the adaptive compression policy existed
+		// have no "encoding" field and were always zstd.
+		storedEnc := stored.Encoding
+		if storedEnc == "" {
+			storedEnc = "zstd"
+		}
+		enc, ok := compress.ParseEncoding(storedEnc)
+		if !ok {
+			c.JSON(500, gin.H{"error": "Unknown stored encoding"})
+			return
+		}
+
+		html, err := compress.Decode(enc, dictMgr.DDict(stored.Blog), compressedHTML)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to decompress stored body"})
+			return
+		}
+		compress.SetBlog(c, stored.Blog)
+
+		// compress.Middleware re-encodes this according to the request's
+		// Accept-Encoding header before it reaches the client.
+		c.Data(200, "text/html; charset=utf-8", html)
+	})
+
 	fmt.Printf("Starting server on port %d\n", *port)
 
 	// run the server